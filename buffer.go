@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultUploadChunkSize = 5 * 1024 * 1024
+	defaultUploadTimeout   = 5 * time.Minute
+	bufferScanInterval     = 10 * time.Second
+)
+
+// parseByteSize parses sizes like "5MB", "512KB" or a bare byte count into
+// a number of bytes.
+func parseByteSize(size string) (int64, error) {
+	size = strings.TrimSpace(size)
+	multiplier := int64(1)
+	switch {
+	case strings.HasSuffix(size, "GB"):
+		multiplier = 1024 * 1024 * 1024
+		size = strings.TrimSuffix(size, "GB")
+	case strings.HasSuffix(size, "MB"):
+		multiplier = 1024 * 1024
+		size = strings.TrimSuffix(size, "MB")
+	case strings.HasSuffix(size, "KB"):
+		multiplier = 1024
+		size = strings.TrimSuffix(size, "KB")
+	case strings.HasSuffix(size, "B"):
+		size = strings.TrimSuffix(size, "B")
+	}
+
+	n, err := strconv.ParseInt(strings.TrimSpace(size), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid byte size %q: %v", size, err)
+	}
+
+	return n * multiplier, nil
+}
+
+// bufferChunk is a single per-tag chunk file being appended to on disk
+// before the uploader hands it off to S3.
+type bufferChunk struct {
+	path   string
+	file   *os.File
+	writer *bufio.Writer
+	size   int64
+	oldest time.Time
+}
+
+// diskBuffer is a write-ahead buffer that persists flushed records to disk
+// under BufferDir/<tag>/<uuid>.log before a background worker uploads them
+// to S3.
+type diskBuffer struct {
+	dir           string
+	chunkSize     int64
+	uploadTimeout time.Duration
+	logger        *log.Logger
+
+	mu   sync.Mutex
+	open map[string]*bufferChunk
+}
+
+func newDiskBuffer(dir string, chunkSize int64, uploadTimeout time.Duration, logger *log.Logger) *diskBuffer {
+	return &diskBuffer{
+		dir:           dir,
+		chunkSize:     chunkSize,
+		uploadTimeout: uploadTimeout,
+		logger:        logger,
+		open:          make(map[string]*bufferChunk),
+	}
+}
+
+// Write appends data to the open chunk file for tag, creating one if needed.
+func (b *diskBuffer) Write(tag string, data []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	chunk, ok := b.open[tag]
+	if !ok {
+		var err error
+		chunk, err = b.createChunk(tag)
+		if err != nil {
+			return err
+		}
+		b.open[tag] = chunk
+	}
+
+	n, err := chunk.writer.Write(data)
+	chunk.size += int64(n)
+	bufferBytes.Add(float64(n))
+	if err != nil {
+		return err
+	}
+
+	return chunk.writer.Flush()
+}
+
+func (b *diskBuffer) createChunk(tag string) (*bufferChunk, error) {
+	dir := filepath.Join(b.dir, tag)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	path := filepath.Join(dir, uuid.New().String()+".log")
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	return &bufferChunk{
+		path:   path,
+		file:   f,
+		writer: bufio.NewWriter(f),
+		oldest: time.Now(),
+	}, nil
+}
+
+// closeStale closes (but does not delete) any open chunk that has grown
+// past chunkSize or whose oldest record has been sitting longer than
+// uploadTimeout, so the next scan can pick it up for upload.
+func (b *diskBuffer) closeStale() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for tag, chunk := range b.open {
+		if chunk.size >= b.chunkSize || time.Since(chunk.oldest) >= b.uploadTimeout {
+			if err := chunk.file.Close(); err != nil {
+				b.logger.Warnf("error closing buffer chunk %s: %v", chunk.path, err)
+			}
+			delete(b.open, tag)
+		}
+	}
+}
+
+func (b *diskBuffer) isOpen(path string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, chunk := range b.open {
+		if chunk.path == path {
+			return true
+		}
+	}
+
+	return false
+}
+
+// scanAndUpload closes any chunk that has crossed a threshold, then walks
+// BufferDir uploading every closed chunk file it finds (including ones
+// left over from a previous process that never got uploaded).
+func (b *diskBuffer) scanAndUpload(operator *s3operator) {
+	b.closeStale()
+
+	_ = filepath.Walk(b.dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info == nil || info.IsDir() {
+			return nil
+		}
+		if !strings.HasSuffix(path, ".log") && !strings.HasSuffix(path, ".log.gz") {
+			return nil
+		}
+		if b.isOpen(path) {
+			return nil
+		}
+
+		b.uploadChunk(operator, path)
+		return nil
+	})
+}
+
+func (b *diskBuffer) uploadChunk(operator *s3operator, path string) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		b.logger.Warnf("error reading buffer chunk %s: %v", path, err)
+		return
+	}
+	if len(data) == 0 {
+		os.Remove(path)
+		return
+	}
+
+	objectKey := GenerateObjectKey(operator, time.Now())
+	// Buffered chunks may contain records from multiple flushes, so there is
+	// no single "first record" to template S3 object tags from; apply the
+	// static S3ObjectTags only.
+	tagging := staticObjectTagging(operator)
+	if err := plugin.Put(operator, objectKey, time.Now(), string(data), tagging); err != nil {
+		b.logger.Warnf("error uploading buffer chunk %s: %v", path, err)
+		return
+	}
+	bufferBytes.Sub(float64(len(data)))
+
+	if err := os.Remove(path); err != nil {
+		b.logger.Warnf("error removing uploaded buffer chunk %s: %v", path, err)
+	}
+}
+
+// startUploader launches the background worker that periodically scans
+// BufferDir and uploads chunks that are ready. It scans immediately on
+// start so chunks left behind by a previous process are picked up without
+// blocking plugin init.
+func (b *diskBuffer) startUploader(operator *s3operator) {
+	// Count chunk files left over from a previous process, so the buffer
+	// gauge stays accurate when the first scan uploads them.
+	_ = filepath.Walk(b.dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && info != nil && !info.IsDir() && (strings.HasSuffix(path, ".log") || strings.HasSuffix(path, ".log.gz")) {
+			bufferBytes.Add(float64(info.Size()))
+		}
+		return nil
+	})
+
+	go func() {
+		b.scanAndUpload(operator)
+
+		ticker := time.NewTicker(bufferScanInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			b.scanAndUpload(operator)
+		}
+	}()
+}
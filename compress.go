@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// compressor turns flushed record bytes into their on-the-wire
+// representation before upload, and tells the uploader what extension and
+// Content-Encoding header the result should carry.
+type compressor interface {
+	Compress(data []byte) ([]byte, error)
+	ContentEncoding() string
+	FileExt() string
+}
+
+// newCompressor maps the Compress config value to a compressor
+// implementation. zstd encoders are expensive to construct, so the
+// returned value should be cached and reused for the lifetime of the
+// operator rather than rebuilt per upload.
+func newCompressor(compress string) (compressor, error) {
+	switch compress {
+	case "", "none":
+		return noneCompressor{}, nil
+	case "gzip":
+		return gzipCompressor{}, nil
+	case "zstd":
+		return newZstdCompressor()
+	case "snappy":
+		return snappyCompressor{}, nil
+	default:
+		return nil, fmt.Errorf("invalid Compress: %s (must be none, gzip, zstd, or snappy)", compress)
+	}
+}
+
+type noneCompressor struct{}
+
+func (noneCompressor) Compress(data []byte) ([]byte, error) { return data, nil }
+func (noneCompressor) ContentEncoding() string              { return "" }
+func (noneCompressor) FileExt() string                      { return ".log" }
+
+type gzipCompressor struct{}
+
+func (gzipCompressor) Compress(data []byte) ([]byte, error) { return makeGzip(data) }
+func (gzipCompressor) ContentEncoding() string              { return "gzip" }
+func (gzipCompressor) FileExt() string                      { return ".log.gz" }
+
+// zstdCompressor reuses a single *zstd.Encoder across uploads, since
+// constructing one is too expensive to do per flush.
+type zstdCompressor struct {
+	encoder *zstd.Encoder
+}
+
+func newZstdCompressor() (*zstdCompressor, error) {
+	encoder, err := zstd.NewWriter(nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create zstd encoder: %v", err)
+	}
+	return &zstdCompressor{encoder: encoder}, nil
+}
+
+func (c *zstdCompressor) Compress(data []byte) ([]byte, error) {
+	return c.encoder.EncodeAll(data, make([]byte, 0, len(data))), nil
+}
+func (c *zstdCompressor) ContentEncoding() string { return "zstd" }
+func (c *zstdCompressor) FileExt() string         { return ".log.zst" }
+
+type snappyCompressor struct{}
+
+func (snappyCompressor) Compress(data []byte) ([]byte, error) {
+	return snappy.Encode(nil, data), nil
+}
+func (snappyCompressor) ContentEncoding() string { return "snappy" }
+func (snappyCompressor) FileExt() string         { return ".log.snappy" }
@@ -0,0 +1,49 @@
+package main
+
+import "testing"
+
+func TestNewCompressor(t *testing.T) {
+	cases := []struct {
+		compress        string
+		wantType        compressor
+		contentEncoding string
+	}{
+		{"", noneCompressor{}, ""},
+		{"none", noneCompressor{}, ""},
+		{"gzip", gzipCompressor{}, "gzip"},
+		{"snappy", snappyCompressor{}, "snappy"},
+	}
+
+	for _, c := range cases {
+		comp, err := newCompressor(c.compress)
+		if err != nil {
+			t.Errorf("newCompressor(%q): unexpected error: %v", c.compress, err)
+			continue
+		}
+		if comp.ContentEncoding() != c.contentEncoding {
+			t.Errorf("newCompressor(%q).ContentEncoding() = %q, want %q", c.compress, comp.ContentEncoding(), c.contentEncoding)
+		}
+	}
+
+	if comp, err := newCompressor("zstd"); err != nil {
+		t.Errorf("newCompressor(\"zstd\"): unexpected error: %v", err)
+	} else if comp.ContentEncoding() != "zstd" {
+		t.Errorf("newCompressor(\"zstd\").ContentEncoding() = %q, want zstd", comp.ContentEncoding())
+	}
+
+	if _, err := newCompressor("bogus"); err == nil {
+		t.Error("expected an unknown Compress value to be rejected")
+	}
+}
+
+func TestCompressRoundTrip(t *testing.T) {
+	for _, name := range []string{"none", "gzip", "zstd", "snappy"} {
+		comp, err := newCompressor(name)
+		if err != nil {
+			t.Fatalf("newCompressor(%q): %v", name, err)
+		}
+		if _, err := comp.Compress([]byte("hello world")); err != nil {
+			t.Errorf("%s Compress: unexpected error: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	recordsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "fluentbit_s3_records_total",
+		Help: "Total number of records flushed through the S3 output plugin.",
+	}, []string{"operator_id"})
+
+	uploadBytesTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "fluentbit_s3_upload_bytes_total",
+		Help: "Total number of bytes uploaded to S3.",
+	})
+
+	uploadDurationSeconds = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "fluentbit_s3_upload_duration_seconds",
+		Help:    "Duration of S3 upload requests in seconds.",
+		Buckets: prometheus.DefBuckets,
+	})
+
+	uploadErrorsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "fluentbit_s3_upload_errors_total",
+		Help: "Total number of failed S3 uploads and bucket-creation requests, labeled by AWS error code.",
+	}, []string{"code"})
+
+	retryTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "fluentbit_s3_retry_total",
+		Help: "Total number of S3 upload retry attempts.",
+	})
+
+	bufferBytes = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "fluentbit_s3_buffer_bytes",
+		Help: "Current number of bytes sitting in the on-disk write-ahead buffer.",
+	})
+)
+
+var metricsServerOnce sync.Once
+
+// startMetricsServer starts the Prometheus HTTP endpoint once per process.
+// Multiple S3 output instances in the same Fluent Bit process share this
+// one endpoint.
+func startMetricsServer(addr, path string) {
+	if addr == "" {
+		return
+	}
+
+	metricsServerOnce.Do(func() {
+		mux := http.NewServeMux()
+		mux.Handle(path, promhttp.Handler())
+
+		go func() {
+			if err := http.ListenAndServe(addr, mux); err != nil {
+				logger.Warnf("metrics server stopped: %v", err)
+			}
+		}()
+	})
+}
+
+// errorCode returns the AWS error code for err, or "unknown" if err is not
+// an awserr.Error.
+func errorCode(err error) string {
+	if terminal, ok := err.(*terminalUploadError); ok {
+		err = terminal.Unwrap()
+	}
+	if aerr, ok := err.(awserr.Error); ok {
+		return aerr.Code()
+	}
+	return "unknown"
+}
@@ -14,9 +14,12 @@ import (
 	"C"
 	"bytes"
 	"compress/gzip"
+	"context"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"text/template"
 	"time"
 	"unsafe"
 )
@@ -30,12 +33,23 @@ func init() {
 }
 
 type s3operator struct {
-	bucket         string
-	prefix         string
-	uploader       *s3manager.Uploader
-	compressFormat format
-	logger         *log.Logger
-	location       *time.Location
+	operatorID        int
+	bucket            string
+	prefix            string
+	uploader          *s3manager.Uploader
+	compressor        compressor
+	logger            *log.Logger
+	location          *time.Location
+	buffer            *diskBuffer
+	metricsAddr       string
+	metricsPath       string
+	uploadTimeout     time.Duration
+	requestTimeout    time.Duration
+	maxRetries        int
+	retryInitialWait  time.Duration
+	objectTags        map[string]string
+	objectTagTemplate *template.Template
+	sse               *sseConfig
 }
 
 type GoOutputPlugin interface {
@@ -43,7 +57,7 @@ type GoOutputPlugin interface {
 	Unregister(ctx unsafe.Pointer)
 	GetRecord(dec *output.FLBDecoder) (ret int, ts interface{}, rec map[interface{}]interface{})
 	NewDecoder(data unsafe.Pointer, length int) *output.FLBDecoder
-	Put(s3operator *s3operator, objectKey string, timestamp time.Time, line string) error
+	Put(s3operator *s3operator, objectKey string, timestamp time.Time, line string, tagging string) error
 	Exit(code int)
 }
 
@@ -69,27 +83,22 @@ func (p *fluentPlugin) Exit(code int) {
 	os.Exit(code)
 }
 
-func (p *fluentPlugin) Put(s3operator *s3operator, objectKey string, timestamp time.Time, line string) error {
-	switch s3operator.compressFormat {
-	case plainTextFormat:
-		_, err := s3operator.uploader.Upload(&s3manager.UploadInput{
-			Bucket: aws.String(s3operator.bucket),
-			Key:    aws.String(objectKey),
-			Body:   strings.NewReader(line),
-		})
-		return err
-	case gzipFormat:
-		compressed, err := makeGzip([]byte(line))
-		if err != nil {
-			return err
-		}
-		_, err = s3operator.uploader.Upload(&s3manager.UploadInput{
-			Bucket: aws.String(s3operator.bucket),
-			Key:    aws.String(objectKey),
-			Body:   bytes.NewReader(compressed),
-		})
+func (p *fluentPlugin) Put(s3operator *s3operator, objectKey string, timestamp time.Time, line string, tagging string) error {
+	start := time.Now()
+	var uploadedBytes int
+
+	compressed, err := s3operator.compressor.Compress([]byte(line))
+	if err == nil {
+		uploadedBytes = len(compressed)
+		err = uploadWithRetry(context.Background(), s3operator.uploader, s3operator.bucket, objectKey, tagging, s3operator.sse, s3operator.compressor.ContentEncoding(), bytes.NewReader(compressed), s3operator.maxRetries, s3operator.retryInitialWait, s3operator.requestTimeout)
+	}
+
+	uploadDurationSeconds.Observe(time.Since(start).Seconds())
+	if err != nil {
+		uploadErrorsTotal.WithLabelValues(errorCode(err)).Inc()
 		return err
 	}
+	uploadBytesTotal.Add(float64(uploadedBytes))
 
 	return nil
 }
@@ -151,9 +160,11 @@ func ensureBucket(session *session.Session, bucket, region *string) (bool, error
 				return true, nil
 			default:
 				logger.Tracef("CreateBucket is failed with: %s", aerr.Error())
+				uploadErrorsTotal.WithLabelValues(aerr.Code()).Inc()
 				return false, aerr
 			}
 		} else {
+			uploadErrorsTotal.WithLabelValues(errorCode(err)).Inc()
 			return false, err
 		}
 	}
@@ -179,8 +190,25 @@ func newS3Output(ctx unsafe.Pointer, operatorID int) (*s3operator, error) {
 	autoCreateBucket := plugin.PluginConfigKey(ctx, "AutoCreateBucket")
 	logLevel := plugin.PluginConfigKey(ctx, "LogLevel")
 	timeZone := plugin.PluginConfigKey(ctx, "TimeZone")
-
-	config, err := getS3Config(accessKeyID, secretAccessKey, credential, s3prefix, bucket, region, compress, endpoint, autoCreateBucket, logLevel, timeZone)
+	bufferDir := plugin.PluginConfigKey(ctx, "BufferDir")
+	uploadChunkSize := plugin.PluginConfigKey(ctx, "UploadChunkSize")
+	uploadTimeout := plugin.PluginConfigKey(ctx, "UploadTimeout")
+	metricsAddr := plugin.PluginConfigKey(ctx, "MetricsAddr")
+	metricsPath := plugin.PluginConfigKey(ctx, "MetricsPath")
+	connectTimeout := plugin.PluginConfigKey(ctx, "ConnectTimeout")
+	s3RequestTimeout := plugin.PluginConfigKey(ctx, "S3RequestTimeout")
+	maxRetries := plugin.PluginConfigKey(ctx, "MaxRetries")
+	retryInitialInterval := plugin.PluginConfigKey(ctx, "RetryInitialInterval")
+	s3ObjectTags := plugin.PluginConfigKey(ctx, "S3ObjectTags")
+	s3ObjectTagTemplate := plugin.PluginConfigKey(ctx, "S3ObjectTagTemplate")
+	sseType := plugin.PluginConfigKey(ctx, "SSEType")
+	sseKMSKeyID := plugin.PluginConfigKey(ctx, "SSEKMSKeyID")
+	sseCustomerKey := plugin.PluginConfigKey(ctx, "SSECustomerKey")
+	roleARN := plugin.PluginConfigKey(ctx, "RoleARN")
+	roleSessionName := plugin.PluginConfigKey(ctx, "RoleSessionName")
+	externalID := plugin.PluginConfigKey(ctx, "ExternalID")
+
+	config, err := getS3Config(accessKeyID, secretAccessKey, credential, s3prefix, bucket, region, compress, endpoint, autoCreateBucket, logLevel, timeZone, bufferDir, uploadChunkSize, uploadTimeout, metricsAddr, metricsPath, connectTimeout, s3RequestTimeout, maxRetries, retryInitialInterval, s3ObjectTags, s3ObjectTagTemplate, sseType, sseKMSKeyID, sseCustomerKey, roleARN, roleSessionName, externalID)
 	if err != nil {
 		return nil, err
 	}
@@ -197,10 +225,14 @@ func newS3Output(ctx unsafe.Pointer, operatorID int) (*s3operator, error) {
 	logger.Infof("[flb-go %d] plugin endpoint parameter = '%s'", operatorID, endpoint)
 	logger.Infof("[flb-go %d] plugin autoCreateBucket parameter = '%s'", operatorID, autoCreateBucket)
 	logger.Infof("[flb-go %d] plugin timeZone parameter = '%s'", operatorID, timeZone)
+	logger.Infof("[flb-go %d] plugin bufferDir parameter = '%s'", operatorID, bufferDir)
+	logger.Infof("[flb-go %d] plugin metricsAddr parameter = '%s'", operatorID, metricsAddr)
+	logger.Infof("[flb-go %d] plugin roleARN parameter = '%s'", operatorID, roleARN)
 
 	cfg := aws.Config{
 		Credentials: config.credentials,
 		Region:      config.region,
+		HTTPClient:  newHTTPClient(config.connectTimeout),
 	}
 	if config.endpoint != "" {
 		cfg.WithEndpoint(config.endpoint).WithS3ForcePathStyle(true)
@@ -221,12 +253,31 @@ func newS3Output(ctx unsafe.Pointer, operatorID int) (*s3operator, error) {
 	})
 
 	s3operator := &s3operator{
-		bucket:         *config.bucket,
-		prefix:         *config.s3prefix,
-		uploader:       uploader,
-		compressFormat: config.compress,
-		logger:         logger,
-		location:       config.location,
+		operatorID:        operatorID,
+		bucket:            *config.bucket,
+		prefix:            *config.s3prefix,
+		uploader:          uploader,
+		compressor:        config.compressor,
+		logger:            logger,
+		location:          config.location,
+		metricsAddr:       config.metricsAddr,
+		metricsPath:       config.metricsPath,
+		uploadTimeout:     config.uploadTimeout,
+		requestTimeout:    config.requestTimeout,
+		maxRetries:        config.maxRetries,
+		retryInitialWait:  config.retryInitialWait,
+		objectTags:        config.objectTags,
+		objectTagTemplate: config.objectTagTemplate,
+		sse:               config.sse,
+	}
+
+	if config.bufferDir != "" {
+		buffer := newDiskBuffer(config.bufferDir, config.uploadChunkSize, config.uploadTimeout, logger)
+		s3operator.buffer = buffer
+		// startUploader picks up any chunk files left behind by a previous
+		// process in its first scan, run in the background so init doesn't
+		// block on an upload.
+		buffer.startUploader(s3operator)
 	}
 
 	return s3operator, nil
@@ -243,6 +294,8 @@ func addS3Output(ctx unsafe.Pointer) error {
 		return err
 	}
 
+	startMetricsServer(operator.metricsAddr, operator.metricsPath)
+
 	s3operators = append(s3operators, operator)
 	return nil
 }
@@ -252,9 +305,10 @@ func getS3Operator(ctx unsafe.Pointer) *s3operator {
 	return s3operators[operatorID]
 }
 
-//export FLBPluginInit
 // (fluentbit will call this)
 // ctx (context) pointer to fluentbit context (state/ c code)
+//
+//export FLBPluginInit
 func FLBPluginInit(ctx unsafe.Pointer) int {
 	err := addS3Output(ctx)
 	if err != nil {
@@ -280,12 +334,16 @@ func FLBPluginFlushCtx(ctx, data unsafe.Pointer, length C.int, tag *C.char) int
 	s3operator := getS3Operator(ctx)
 	dec := plugin.NewDecoder(data, int(length))
 	var lines string
+	var firstRecord map[interface{}]interface{}
 
 	for {
 		ret, _, record = plugin.GetRecord(dec)
 		if ret != 0 {
 			break
 		}
+		if firstRecord == nil {
+			firstRecord = record
+		}
 
 		line, err := createJSON(record)
 		if err != nil {
@@ -293,12 +351,25 @@ func FLBPluginFlushCtx(ctx, data unsafe.Pointer, length C.int, tag *C.char) int
 			continue
 		}
 		lines += line + "\n"
+		recordsTotal.WithLabelValues(strconv.Itoa(s3operator.operatorID)).Inc()
+	}
+
+	if s3operator.buffer != nil {
+		if err := s3operator.buffer.Write(C.GoString(tag), []byte(lines)); err != nil {
+			s3operator.logger.Warnf("error buffering message for S3: %v", err)
+			return output.FLB_RETRY
+		}
+		return output.FLB_OK
 	}
 
 	objectKey := GenerateObjectKey(s3operator, time.Now())
-	err := plugin.Put(s3operator, objectKey, time.Now(), lines)
+	tagging := resolveObjectTagging(s3operator, firstRecord)
+	err := plugin.Put(s3operator, objectKey, time.Now(), lines, tagging)
 	if err != nil {
 		s3operator.logger.Warnf("error sending message for S3: %v", err)
+		if isTerminalUploadError(err) {
+			return output.FLB_ERROR
+		}
 		return output.FLB_RETRY
 	}
 
@@ -312,13 +383,7 @@ func FLBPluginFlushCtx(ctx, data unsafe.Pointer, length C.int, tag *C.char) int
 
 // format is S3_PREFIX/S3_TRAILING_PREFIX/date/hour/timestamp_uuid.log
 func GenerateObjectKey(s3operator *s3operator, t time.Time) string {
-	var fileext string
-	switch s3operator.compressFormat {
-	case plainTextFormat:
-		fileext = ".log"
-	case gzipFormat:
-		fileext = ".log.gz"
-	}
+	fileext := s3operator.compressor.FileExt()
 	// Convert time.Time object's Local with specified TimeZone's
 	time.Local = s3operator.location
 	timestamp := t.Local().Format("20060102150405")
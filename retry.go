@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+const (
+	defaultConnectTimeout       = 10 * time.Second
+	defaultRequestTimeout       = 10 * time.Second
+	defaultMaxRetries           = 3
+	defaultRetryInitialInterval = 500 * time.Millisecond
+)
+
+// terminalUploadError wraps an upload failure that retrying cannot fix
+// (bad credentials, missing bucket, ...) so FLBPluginFlushCtx can return
+// output.FLB_ERROR instead of output.FLB_RETRY.
+type terminalUploadError struct {
+	err error
+}
+
+func (e *terminalUploadError) Error() string { return e.err.Error() }
+func (e *terminalUploadError) Unwrap() error { return e.err }
+
+func isTerminalUploadError(err error) bool {
+	_, ok := err.(*terminalUploadError)
+	return ok
+}
+
+// newHTTPClient builds an http.Client with a bounded dial and response
+// header timeout, so a slow or unreachable S3 endpoint can't stall the
+// Fluent Bit pipeline indefinitely.
+func newHTTPClient(connectTimeout time.Duration) *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext: (&net.Dialer{
+				Timeout: connectTimeout,
+			}).DialContext,
+			ResponseHeaderTimeout: connectTimeout,
+		},
+	}
+}
+
+// isRetryableError reports whether err is worth retrying. Network errors
+// and S3 errors that are unrecognized by the AWS SDK are treated as
+// retryable; well-known terminal error codes are not.
+func isRetryableError(err error) bool {
+	aerr, ok := err.(awserr.Error)
+	if !ok {
+		return true
+	}
+
+	switch aerr.Code() {
+	case "AccessDenied", s3.ErrCodeNoSuchBucket:
+		return false
+	case "RequestTimeout", "SlowDown", "InternalError", "RequestTimeoutException":
+		return true
+	}
+
+	return true
+}
+
+// uploadWithRetry retries an S3 upload with exponential backoff and jitter
+// on retryable errors, giving up immediately on terminal ones. body must
+// support Seek so a retry can rewind it. Each attempt gets its own
+// requestTimeout budget off ctx, so one slow attempt can't starve the
+// retries that follow it.
+func uploadWithRetry(ctx context.Context, uploader *s3manager.Uploader, bucket, key, tagging string, sse *sseConfig, contentEncoding string, body io.ReadSeeker, maxRetries int, initialInterval, requestTimeout time.Duration) error {
+	interval := initialInterval
+	var lastErr error
+
+	input := &s3manager.UploadInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+		Body:   body,
+	}
+	if tagging != "" {
+		input.Tagging = aws.String(tagging)
+	}
+	if contentEncoding != "" {
+		input.ContentEncoding = aws.String(contentEncoding)
+	}
+	sse.apply(input)
+
+	for attempt := 0; attempt <= maxRetries; attempt++ {
+		if attempt > 0 {
+			retryTotal.Inc()
+			if _, err := body.Seek(0, io.SeekStart); err != nil {
+				return err
+			}
+			sleep := interval/2 + time.Duration(rand.Int63n(int64(interval)/2+1))
+			time.Sleep(sleep)
+			interval *= 2
+		}
+
+		attemptCtx, cancel := context.WithTimeout(ctx, requestTimeout)
+		_, err := uploader.UploadWithContext(attemptCtx, input)
+		cancel()
+		if err == nil {
+			return nil
+		}
+
+		lastErr = err
+		if !isRetryableError(err) {
+			return &terminalUploadError{err: err}
+		}
+	}
+
+	return lastErr
+}
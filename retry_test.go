@@ -0,0 +1,34 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+func TestIsRetryableError(t *testing.T) {
+	if !isRetryableError(errors.New("boom")) {
+		t.Error("expected a plain, non-awserr error to be retryable")
+	}
+
+	cases := []struct {
+		code      string
+		retryable bool
+	}{
+		{"AccessDenied", false},
+		{s3.ErrCodeNoSuchBucket, false},
+		{"RequestTimeout", true},
+		{"SlowDown", true},
+		{"InternalError", true},
+		{"SomethingUnrecognized", true},
+	}
+
+	for _, c := range cases {
+		err := awserr.New(c.code, "test", nil)
+		if got := isRetryableError(err); got != c.retryable {
+			t.Errorf("isRetryableError(%s) = %v, want %v", c.code, got, c.retryable)
+		}
+	}
+}
@@ -2,75 +2,122 @@ package main
 
 import "github.com/aws/aws-sdk-go/aws"
 import "github.com/aws/aws-sdk-go/aws/credentials"
+import "github.com/aws/aws-sdk-go/aws/credentials/ec2rolecreds"
+import "github.com/aws/aws-sdk-go/aws/credentials/endpointcreds"
+import "github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+import "github.com/aws/aws-sdk-go/aws/ec2metadata"
+import "github.com/aws/aws-sdk-go/aws/session"
+import "github.com/aws/aws-sdk-go/service/sts"
 import log "github.com/sirupsen/logrus"
 
 import (
 	"fmt"
+	"os"
 	"strconv"
 	"strings"
+	"text/template"
 	"time"
 )
 
-type format int
-
-const (
-	plainTextFormat format = iota
-	gzipFormat
-)
-
 type s3Config struct {
-	credentials      *credentials.Credentials
-	bucket           *string
-	s3prefix         *string
-	region           *string
-	compress         format
-	endpoint         string
-	logLevel         log.Level
-	location         *time.Location
-	autoCreateBucket bool
+	credentials       *credentials.Credentials
+	bucket            *string
+	s3prefix          *string
+	region            *string
+	compressor        compressor
+	endpoint          string
+	logLevel          log.Level
+	location          *time.Location
+	autoCreateBucket  bool
+	bufferDir         string
+	uploadChunkSize   int64
+	uploadTimeout     time.Duration
+	metricsAddr       string
+	metricsPath       string
+	connectTimeout    time.Duration
+	requestTimeout    time.Duration
+	maxRetries        int
+	retryInitialWait  time.Duration
+	objectTags        map[string]string
+	objectTagTemplate *template.Template
+	sse               *sseConfig
 }
 
 type S3Credential interface {
-	GetCredentials(accessID, secretkey, credentials string) (*credentials.Credentials, error)
+	GetCredentials(accessID, secretKey, credential, roleARN, roleSessionName, externalID string) (*credentials.Credentials, error)
 }
 
 type s3PluginConfig struct{}
 
 var s3Creds S3Credential = &s3PluginConfig{}
 
-func (c *s3PluginConfig) GetCredentials(accessKeyID, secretKey, credential string) (*credentials.Credentials, error) {
-	var creds *credentials.Credentials
+// GetCredentials resolves AWS credentials from a chain of providers, tried
+// in order: static access keys, a shared credentials file, AssumeRole (if
+// RoleARN is set), the EC2 instance metadata service, the ECS task role
+// endpoint, and finally the environment. This mirrors the precedence
+// Fluent Bit deployments on EKS/ECS/EC2 expect from the default AWS SDK
+// credential chain.
+func (c *s3PluginConfig) GetCredentials(accessKeyID, secretKey, credential, roleARN, roleSessionName, externalID string) (*credentials.Credentials, error) {
+	sess, err := session.NewSession()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AWS session for credential resolution: %v", err)
+	}
+
+	var providers []credentials.Provider
+
+	if !(accessKeyID == "" && secretKey == "") {
+		providers = append(providers, &credentials.StaticProvider{
+			Value: credentials.Value{AccessKeyID: accessKeyID, SecretAccessKey: secretKey},
+		})
+	}
+
 	if credential != "" {
-		creds = credentials.NewSharedCredentials(credential, "default")
-		if _, err := creds.Get(); err != nil {
-			fmt.Println("[SharedCredentials] ERROR:", err)
-		} else {
-			return creds, nil
+		providers = append(providers, &credentials.SharedCredentialsProvider{
+			Filename: credential,
+			Profile:  "default",
+		})
+	}
+
+	if roleARN != "" {
+		if roleSessionName == "" {
+			roleSessionName = "fluent-bit-go-s3"
 		}
-	} else if !(accessKeyID == "" && secretKey == "") {
-		creds = credentials.NewStaticCredentials(accessKeyID, secretKey, "")
-		if _, err := creds.Get(); err != nil {
-			fmt.Println("[StaticCredentials] ERROR:", err)
-		} else {
-			return creds, nil
+		assumeRoleProvider := &stscreds.AssumeRoleProvider{
+			Client:          sts.New(sess),
+			RoleARN:         roleARN,
+			RoleSessionName: roleSessionName,
 		}
-	} else {
-		creds = credentials.NewEnvCredentials()
-		if _, err := creds.Get(); err != nil {
-			fmt.Println("[EnvCredentials] ERROR:", err)
-		} else {
-			return creds, nil
+		if externalID != "" {
+			assumeRoleProvider.ExternalID = aws.String(externalID)
 		}
+		providers = append(providers, assumeRoleProvider)
+	}
+
+	providers = append(providers, &ec2rolecreds.EC2RoleProvider{
+		Client: ec2metadata.New(sess),
+	})
+
+	if uri := os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"); uri != "" {
+		providers = append(providers, endpointcreds.NewProviderClient(*sess.Config, sess.Handlers, "http://169.254.170.2"+uri))
+	}
+
+	providers = append(providers, &credentials.EnvProvider{})
+
+	chain := credentials.NewChainCredentials(providers)
+	value, err := chain.Get()
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve AWS credentials: %v", err)
 	}
+	logger.Infof("resolved AWS credentials via %s provider (accessKeyID=%s)", value.ProviderName, obfuscateSecret(value.AccessKeyID))
 
-	return nil, fmt.Errorf("Failed to create credentials")
+	return chain, nil
 }
 
-func getS3Config(accessID, secretKey, credential, s3prefix, bucket, region, compress, endpoint, autoCreateBucket, logLevel, timeZone string) (*s3Config, error) {
+func getS3Config(accessID, secretKey, credential, s3prefix, bucket, region, compress, endpoint, autoCreateBucket, logLevel, timeZone, bufferDir, uploadChunkSize, uploadTimeout, metricsAddr, metricsPath, connectTimeout, s3RequestTimeout, maxRetries, retryInitialInterval, s3ObjectTags, s3ObjectTagTemplate, sseType, sseKMSKeyID, sseCustomerKey, roleARN, roleSessionName, externalID string) (*s3Config, error) {
 	conf := &s3Config{}
-	creds, err := s3Creds.GetCredentials(accessID, secretKey, credential)
+	creds, err := s3Creds.GetCredentials(accessID, secretKey, credential, roleARN, roleSessionName, externalID)
 	if err != nil {
-		return nil, fmt.Errorf("Failed to create credentials")
+		return nil, fmt.Errorf("Failed to create credentials: %v", err)
 	}
 	conf.credentials = creds
 
@@ -89,12 +136,11 @@ func getS3Config(accessID, secretKey, credential, s3prefix, bucket, region, comp
 	}
 	conf.region = aws.String(region)
 
-	switch compress {
-	case "gzip":
-		conf.compress = gzipFormat
-	default:
-		conf.compress = plainTextFormat
+	comp, err := newCompressor(compress)
+	if err != nil {
+		return nil, err
 	}
+	conf.compressor = comp
 
 	if endpoint != "" {
 		if strings.HasSuffix(endpoint, "amazonaws.com") {
@@ -130,5 +176,95 @@ func getS3Config(accessID, secretKey, credential, s3prefix, bucket, region, comp
 		conf.location = time.Local
 	}
 
+	conf.bufferDir = bufferDir
+
+	if uploadChunkSize == "" {
+		conf.uploadChunkSize = defaultUploadChunkSize
+	} else {
+		size, err := parseByteSize(uploadChunkSize)
+		if err != nil {
+			return nil, fmt.Errorf("invalid UploadChunkSize: %v", err)
+		}
+		conf.uploadChunkSize = size
+	}
+
+	if uploadTimeout == "" {
+		conf.uploadTimeout = defaultUploadTimeout
+	} else {
+		timeout, err := time.ParseDuration(uploadTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid UploadTimeout: %v", err)
+		}
+		conf.uploadTimeout = timeout
+	}
+
+	conf.metricsAddr = metricsAddr
+	if metricsPath == "" {
+		conf.metricsPath = "/metrics"
+	} else {
+		conf.metricsPath = metricsPath
+	}
+
+	if connectTimeout == "" {
+		conf.connectTimeout = defaultConnectTimeout
+	} else {
+		timeout, err := time.ParseDuration(connectTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ConnectTimeout: %v", err)
+		}
+		conf.connectTimeout = timeout
+	}
+
+	if s3RequestTimeout == "" {
+		conf.requestTimeout = defaultRequestTimeout
+	} else {
+		timeout, err := time.ParseDuration(s3RequestTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid S3RequestTimeout: %v", err)
+		}
+		conf.requestTimeout = timeout
+	}
+
+	if maxRetries == "" {
+		conf.maxRetries = defaultMaxRetries
+	} else {
+		retries, err := strconv.Atoi(maxRetries)
+		if err != nil {
+			return nil, fmt.Errorf("invalid MaxRetries: %v", err)
+		}
+		conf.maxRetries = retries
+	}
+
+	if retryInitialInterval == "" {
+		conf.retryInitialWait = defaultRetryInitialInterval
+	} else {
+		wait, err := time.ParseDuration(retryInitialInterval)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RetryInitialInterval: %v", err)
+		}
+		conf.retryInitialWait = wait
+	}
+
+	tags, err := parseObjectTags(s3ObjectTags)
+	if err != nil {
+		return nil, fmt.Errorf("invalid S3ObjectTags: %v", err)
+	}
+	if err := validateObjectTags(tags); err != nil {
+		return nil, fmt.Errorf("invalid S3ObjectTags: %v", err)
+	}
+	conf.objectTags = tags
+
+	tmpl, err := parseObjectTagTemplate(s3ObjectTagTemplate)
+	if err != nil {
+		return nil, err
+	}
+	conf.objectTagTemplate = tmpl
+
+	sse, err := parseSSEConfig(sseType, sseKMSKeyID, sseCustomerKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SSE configuration: %v", err)
+	}
+	conf.sse = sse
+
 	return conf, nil
 }
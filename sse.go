@@ -0,0 +1,73 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// sseConfig holds a resolved server-side encryption mode for uploads. The
+// SSE-C customer key and its MD5 are computed once here rather than on
+// every upload.
+type sseConfig struct {
+	sseType        string
+	kmsKeyID       string
+	customerKey    string
+	customerKeyMD5 string
+}
+
+// parseSSEConfig validates the SSEType/SSEKMSKeyID/SSECustomerKey config
+// keys and resolves them into an sseConfig. It returns a nil sseConfig
+// (and no error) when SSEType is unset.
+func parseSSEConfig(sseType, kmsKeyID, customerKeyBase64 string) (*sseConfig, error) {
+	switch sseType {
+	case "":
+		return nil, nil
+	case "AES256":
+		return &sseConfig{sseType: sseType}, nil
+	case "aws:kms":
+		if kmsKeyID == "" {
+			return nil, fmt.Errorf("SSEKMSKeyID is required when SSEType is aws:kms")
+		}
+		return &sseConfig{sseType: sseType, kmsKeyID: kmsKeyID}, nil
+	case "AES256-C":
+		if customerKeyBase64 == "" {
+			return nil, fmt.Errorf("SSECustomerKey is required when SSEType is AES256-C")
+		}
+		key, err := base64.StdEncoding.DecodeString(customerKeyBase64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SSECustomerKey: %v", err)
+		}
+		sum := md5.Sum(key)
+		return &sseConfig{
+			sseType:        sseType,
+			customerKey:    string(key),
+			customerKeyMD5: base64.StdEncoding.EncodeToString(sum[:]),
+		}, nil
+	default:
+		return nil, fmt.Errorf("invalid SSEType: %s (must be AES256, aws:kms, or AES256-C)", sseType)
+	}
+}
+
+// apply sets the server-side encryption fields of input according to the
+// resolved SSE mode. A nil sse leaves input unchanged.
+func (s *sseConfig) apply(input *s3manager.UploadInput) {
+	if s == nil {
+		return
+	}
+
+	switch s.sseType {
+	case "AES256":
+		input.ServerSideEncryption = aws.String("AES256")
+	case "aws:kms":
+		input.ServerSideEncryption = aws.String("aws:kms")
+		input.SSEKMSKeyId = aws.String(s.kmsKeyID)
+	case "AES256-C":
+		input.SSECustomerAlgorithm = aws.String("AES256")
+		input.SSECustomerKey = aws.String(s.customerKey)
+		input.SSECustomerKeyMD5 = aws.String(s.customerKeyMD5)
+	}
+}
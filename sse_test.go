@@ -0,0 +1,38 @@
+package main
+
+import (
+	"encoding/base64"
+	"testing"
+)
+
+func TestParseSSEConfig(t *testing.T) {
+	if sse, err := parseSSEConfig("", "", ""); err != nil || sse != nil {
+		t.Errorf("expected unset SSEType to resolve to nil, got %v, %v", sse, err)
+	}
+
+	if sse, err := parseSSEConfig("AES256", "", ""); err != nil || sse.sseType != "AES256" {
+		t.Errorf("unexpected result for AES256: %v, %v", sse, err)
+	}
+
+	if _, err := parseSSEConfig("aws:kms", "", ""); err == nil {
+		t.Error("expected aws:kms without SSEKMSKeyID to be rejected")
+	}
+	if sse, err := parseSSEConfig("aws:kms", "key-id", ""); err != nil || sse.kmsKeyID != "key-id" {
+		t.Errorf("unexpected result for aws:kms: %v, %v", sse, err)
+	}
+
+	if _, err := parseSSEConfig("AES256-C", "", ""); err == nil {
+		t.Error("expected AES256-C without SSECustomerKey to be rejected")
+	}
+	if _, err := parseSSEConfig("AES256-C", "", "not-base64!"); err == nil {
+		t.Error("expected a non-base64 SSECustomerKey to be rejected")
+	}
+	key := base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef"))
+	if sse, err := parseSSEConfig("AES256-C", "", key); err != nil || sse.customerKeyMD5 == "" {
+		t.Errorf("unexpected result for AES256-C: %v, %v", sse, err)
+	}
+
+	if _, err := parseSSEConfig("bogus", "", ""); err == nil {
+		t.Error("expected an unknown SSEType to be rejected")
+	}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// s3TagCharPattern matches the characters S3 allows in an object tag key or
+// value: letters, numbers, spaces, and + - = . _ : / @.
+var s3TagCharPattern = regexp.MustCompile(`^[A-Za-z0-9 +\-=._:/@]+$`)
+
+// parseObjectTags parses a "k1=v1,k2=v2" tag list into a map.
+func parseObjectTags(raw string) (map[string]string, error) {
+	tags := make(map[string]string)
+	if raw == "" {
+		return tags, nil
+	}
+
+	for _, pair := range strings.Split(raw, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid tag %q, expected key=value", pair)
+		}
+		tags[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+
+	return tags, nil
+}
+
+// validateObjectTags checks that every key/value satisfies S3's character
+// rules for object tags.
+func validateObjectTags(tags map[string]string) error {
+	for k, v := range tags {
+		if len(k) == 0 || len(k) > 128 || !s3TagCharPattern.MatchString(k) {
+			return fmt.Errorf("invalid S3 object tag key %q", k)
+		}
+		if len(v) > 256 || (v != "" && !s3TagCharPattern.MatchString(v)) {
+			return fmt.Errorf("invalid S3 object tag value %q for key %q", v, k)
+		}
+	}
+
+	return nil
+}
+
+// parseObjectTagTemplate parses the S3ObjectTagTemplate config value and
+// validates a sample rendering (with no record fields available, so every
+// templated field degrades to "unknown") against S3's tag rules.
+func parseObjectTagTemplate(raw string) (*template.Template, error) {
+	if raw == "" {
+		return nil, nil
+	}
+
+	tmpl, err := template.New("s3ObjectTagTemplate").Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid S3ObjectTagTemplate: %v", err)
+	}
+
+	rendered, err := renderObjectTagTemplate(tmpl, map[string]interface{}{})
+	if err != nil {
+		return nil, err
+	}
+
+	tags, err := parseObjectTags(rendered)
+	if err != nil {
+		return nil, fmt.Errorf("S3ObjectTagTemplate does not render to a valid tag list: %v", err)
+	}
+	if err := validateObjectTags(tags); err != nil {
+		return nil, fmt.Errorf("S3ObjectTagTemplate: %v", err)
+	}
+
+	return tmpl, nil
+}
+
+// renderObjectTagTemplate executes tmpl against record, degrading any
+// missing or unresolvable field to the literal "unknown" rather than
+// failing the whole render over one bad field. An unresolvable field inside
+// an if, range or with block is not patched and still fails the render.
+func renderObjectTagTemplate(tmpl *template.Template, record map[string]interface{}) (string, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, sanitizeForTemplate(tmpl, record)); err != nil {
+		return "", err
+	}
+
+	return strings.ReplaceAll(buf.String(), "<no value>", "unknown"), nil
+}
+
+// fieldPaths returns the dotted field paths referenced in tmpl's top-level
+// actions, e.g. {{.meta.env}} yields []string{"meta", "env"}. Fields inside
+// if, range or with blocks are not collected.
+func fieldPaths(tmpl *template.Template) [][]string {
+	var paths [][]string
+	if tmpl.Tree == nil {
+		return paths
+	}
+
+	var walk func(nodes []parse.Node)
+	walk = func(nodes []parse.Node) {
+		for _, n := range nodes {
+			switch node := n.(type) {
+			case *parse.ListNode:
+				walk(node.Nodes)
+			case *parse.ActionNode:
+				for _, cmd := range node.Pipe.Cmds {
+					for _, arg := range cmd.Args {
+						if field, ok := arg.(*parse.FieldNode); ok {
+							paths = append(paths, field.Ident)
+						}
+					}
+				}
+			}
+		}
+	}
+	walk(tmpl.Tree.Root.Nodes)
+
+	return paths
+}
+
+// pathResolves reports whether path can be traversed through record without
+// hitting a non-map value before its final segment. A missing key along the
+// way still resolves (text/template renders it as "<no value>" on its own);
+// only a type mismatch would abort tmpl.Execute outright.
+func pathResolves(record map[string]interface{}, path []string) bool {
+	var cur interface{} = record
+	for _, seg := range path[:len(path)-1] {
+		m, ok := cur.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		next, ok := m[seg]
+		if !ok {
+			return true
+		}
+		cur = next
+	}
+
+	_, ok := cur.(map[string]interface{})
+	return ok
+}
+
+// sanitizeForTemplate returns a copy of record safe to execute tmpl
+// against: every field path that would otherwise hit a non-map value
+// partway through is pre-set to "unknown", so that one bad field degrades
+// instead of failing the whole tag template.
+func sanitizeForTemplate(tmpl *template.Template, record map[string]interface{}) map[string]interface{} {
+	safe := record
+	for _, path := range fieldPaths(tmpl) {
+		if len(path) == 0 || pathResolves(safe, path) {
+			continue
+		}
+
+		patched := make(map[string]interface{}, len(safe))
+		for k, v := range safe {
+			patched[k] = v
+		}
+
+		cur := patched
+		for _, seg := range path[:len(path)-1] {
+			next, ok := cur[seg].(map[string]interface{})
+			if !ok {
+				next = make(map[string]interface{})
+				cur[seg] = next
+			}
+			cur = next
+		}
+		cur[path[len(path)-1]] = "unknown"
+
+		safe = patched
+	}
+
+	return safe
+}
+
+// staticObjectTagging builds the URL-encoded S3 object tagging string from
+// just the static S3ObjectTags, for uploads with no single record to
+// template against (e.g. a merged buffer chunk).
+func staticObjectTagging(s3operator *s3operator) string {
+	if len(s3operator.objectTags) == 0 {
+		return ""
+	}
+
+	values := url.Values{}
+	for k, v := range s3operator.objectTags {
+		values.Set(k, v)
+	}
+
+	return values.Encode()
+}
+
+// resolveObjectTagging builds the URL-encoded S3 object tagging string for
+// a flush, combining the static S3ObjectTags with any fields resolved from
+// the S3ObjectTagTemplate against the first record in the flush.
+func resolveObjectTagging(s3operator *s3operator, record map[interface{}]interface{}) string {
+	if len(s3operator.objectTags) == 0 && s3operator.objectTagTemplate == nil {
+		return ""
+	}
+
+	tags := make(map[string]string, len(s3operator.objectTags))
+	for k, v := range s3operator.objectTags {
+		tags[k] = v
+	}
+
+	if s3operator.objectTagTemplate != nil {
+		rendered, err := renderObjectTagTemplate(s3operator.objectTagTemplate, encodeJSON(record))
+		if err != nil {
+			s3operator.logger.Warnf("error rendering S3ObjectTagTemplate: %v", err)
+		} else if templated, err := parseObjectTags(rendered); err == nil {
+			for k, v := range templated {
+				tags[k] = v
+			}
+		}
+	}
+
+	values := url.Values{}
+	for k, v := range tags {
+		values.Set(k, v)
+	}
+
+	return values.Encode()
+}
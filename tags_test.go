@@ -0,0 +1,55 @@
+package main
+
+import "testing"
+
+func TestValidateObjectTags(t *testing.T) {
+	if err := validateObjectTags(map[string]string{"env": "prod", "team": "data-eng"}); err != nil {
+		t.Errorf("expected valid tags to pass, got %v", err)
+	}
+
+	cases := []map[string]string{
+		{"": "prod"},
+		{"env!": "prod"},
+		{"env": "prod#"},
+	}
+	for _, tags := range cases {
+		if err := validateObjectTags(tags); err == nil {
+			t.Errorf("expected %v to be rejected", tags)
+		}
+	}
+}
+
+func TestParseObjectTagTemplate(t *testing.T) {
+	if tmpl, err := parseObjectTagTemplate(""); err != nil || tmpl != nil {
+		t.Errorf("expected empty template to parse as nil, got %v, %v", tmpl, err)
+	}
+
+	if _, err := parseObjectTagTemplate("env={{.env}}"); err != nil {
+		t.Errorf("unexpected error for valid template: %v", err)
+	}
+
+	if _, err := parseObjectTagTemplate("env={{"); err == nil {
+		t.Error("expected malformed template syntax to be rejected")
+	}
+
+	if _, err := parseObjectTagTemplate("not-a-valid-tag-list"); err == nil {
+		t.Error("expected a rendering that isn't a valid tag list to be rejected")
+	}
+}
+
+func TestRenderObjectTagTemplateDegradesBadField(t *testing.T) {
+	tmpl, err := parseObjectTagTemplate("user={{.user.id}}")
+	if err != nil {
+		t.Fatalf("unexpected error parsing template: %v", err)
+	}
+
+	// .user resolves to a string, so .user.id can't be evaluated; the field
+	// should degrade to "unknown" instead of failing the whole render.
+	rendered, err := renderObjectTagTemplate(tmpl, map[string]interface{}{"user": "not-a-map"})
+	if err != nil {
+		t.Fatalf("unexpected error rendering template: %v", err)
+	}
+	if rendered != "user=unknown" {
+		t.Errorf("rendered = %q, want %q", rendered, "user=unknown")
+	}
+}